@@ -0,0 +1,18 @@
+// Package config holds the proxy's on-disk YAML configuration shapes.
+package config
+
+// RuleConfig is one entry of the top-level "rules:" list: a single
+// table's sharding rule.
+type RuleConfig struct {
+	DB    string `yaml:"db"`
+	Table string `yaml:"table"`
+	Key   string `yaml:"key"`
+	Type  string `yaml:"type"`
+	Nodes string `yaml:"nodes"`
+	Range string `yaml:"range"`
+}
+
+// Config is the proxy's full YAML configuration.
+type Config struct {
+	Rules []RuleConfig `yaml:"rules"`
+}
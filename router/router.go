@@ -0,0 +1,213 @@
+package router
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/siddontang/mixer/config"
+)
+
+// Rule types: how a Rule maps a key value to a backend node name.
+const (
+	DefaultRuleType = iota
+	HashRuleType
+	RangeRuleType
+)
+
+// Rule is a single table's sharding rule.
+type Rule struct {
+	DB    string
+	Table string
+	Key   string
+	Type  int
+	Nodes []string
+
+	// bounds holds, for a RangeRuleType rule, the upper bound of every
+	// node but the last, in node order.
+	bounds []int64
+}
+
+// FindNode resolves key to the backend node name it maps to: the single
+// node for a DefaultRuleType rule, key mod len(Nodes) for HashRuleType,
+// or whichever range key falls into for RangeRuleType.
+func (r *Rule) FindNode(key interface{}) string {
+	switch r.Type {
+	case HashRuleType:
+		return r.Nodes[toInt64(key)%int64(len(r.Nodes))]
+	case RangeRuleType:
+		return r.Nodes[r.findRangeIndex(toInt64(key))]
+	default:
+		return r.Nodes[0]
+	}
+}
+
+func (r *Rule) findRangeIndex(key int64) int {
+	for i, bound := range r.bounds {
+		if key < bound {
+			return i
+		}
+	}
+	return len(r.Nodes) - 1
+}
+
+func toInt64(key interface{}) int64 {
+	switch v := key.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+// Router maps (db, table) to the Rule that shards it.
+type Router struct {
+	rules map[string]map[string]*Rule
+}
+
+// NewRouter builds a Router from cfg, returning an error if any rule's
+// node or range spec can't be parsed.
+func NewRouter(cfg *config.Config) (*Router, error) {
+	r := &Router{rules: make(map[string]map[string]*Rule)}
+
+	for i := range cfg.Rules {
+		rule, err := newRule(&cfg.Rules[i])
+		if err != nil {
+			return nil, err
+		}
+
+		db := r.rules[rule.DB]
+		if db == nil {
+			db = make(map[string]*Rule)
+			r.rules[rule.DB] = db
+		}
+		db[rule.Table] = rule
+	}
+
+	return r, nil
+}
+
+func newRule(rc *config.RuleConfig) (*Rule, error) {
+	nodes, err := parseNodes(rc.Nodes)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s.%s: %v", rc.DB, rc.Table, err)
+	}
+
+	rule := &Rule{
+		DB:    rc.DB,
+		Table: rc.Table,
+		Key:   rc.Key,
+		Nodes: nodes,
+	}
+
+	switch rc.Type {
+	case "hash":
+		rule.Type = HashRuleType
+	case "range":
+		rule.Type = RangeRuleType
+
+		bounds, err := parseRange(rc.Range)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s.%s: %v", rc.DB, rc.Table, err)
+		}
+		rule.bounds = bounds
+	case "default", "":
+		rule.Type = DefaultRuleType
+	default:
+		return nil, fmt.Errorf("rule %s.%s: unsupported rule type %q", rc.DB, rc.Table, rc.Type)
+	}
+
+	return rule, nil
+}
+
+// parseNodes parses a rule's "nodes" spec, either a comma-separated list
+// ("node1,node2,node3") or a "node(M-N)" range shorthand expanding to
+// nodeM, node(M+1), ..., nodeN.
+func parseNodes(s string) ([]string, error) {
+	if strings.HasPrefix(s, "node(") && strings.HasSuffix(s, ")") {
+		bounds := strings.SplitN(s[len("node("):len(s)-1], "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid node range %q", s)
+		}
+
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := strconv.Atoi(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+
+		nodes := make([]string, 0, end-start+1)
+		for i := start; i <= end; i++ {
+			nodes = append(nodes, fmt.Sprintf("node%d", i))
+		}
+		return nodes, nil
+	}
+
+	return strings.Split(s, ","), nil
+}
+
+// parseRange parses a rule's "range" spec, e.g. "-10000-20000-": a
+// leading "-" means the first node's range is open below, a trailing
+// "-" means the last node's range is open above, and the numbers in
+// between are the upper bound of every node but the last.
+func parseRange(s string) ([]int64, error) {
+	var bounds []int64
+
+	for _, p := range strings.Split(s, "-") {
+		if p == "" {
+			continue
+		}
+
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, n)
+	}
+
+	return bounds, nil
+}
+
+// GetDBRules returns every rule configured for db, keyed by table name
+// (the db's default rule, if any, under the empty table name), or nil
+// if db has no rules at all.
+func (r *Router) GetDBRules(db string) map[string]*Rule {
+	return r.rules[db]
+}
+
+// GetRule returns table's rule in db, falling back to db's default rule
+// (the one configured with an empty table name) if table has none of
+// its own, or nil if neither exists.
+func (r *Router) GetRule(db, table string) *Rule {
+	rules := r.rules[db]
+	if rules == nil {
+		return nil
+	}
+
+	if rule, ok := rules[table]; ok {
+		return rule
+	}
+
+	return rules[""]
+}
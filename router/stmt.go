@@ -0,0 +1,199 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/siddontang/mixer/src/mysql"
+)
+
+// ShardedStmt is a prepared statement for a sharded table: it was parsed
+// once against rule, and each Exec/Query resolves the backend node(s) to
+// hit from the decoded argument at the shard key's placeholder position,
+// re-preparing against a backend lazily the first time it's needed and
+// caching the result by node name.
+type ShardedStmt struct {
+	rule  *Rule
+	query string
+
+	// keyParamIndex is the 0-based position among the query's `?`
+	// placeholders that binds rule's key column, or -1 if the query
+	// doesn't filter on the key at all.
+	keyParamIndex int
+
+	prepare func(node string) (*mysql.Stmt, error)
+	stmts   map[string]*mysql.Stmt
+}
+
+// NewShardedStmt prepares query for execution against rule's table. It
+// doesn't dial any backend itself: prepare is called lazily, once per
+// node a query actually needs to reach, and is expected to return an
+// already-prepared mysql.Stmt for that node.
+func NewShardedStmt(rule *Rule, query string, prepare func(node string) (*mysql.Stmt, error)) *ShardedStmt {
+	return &ShardedStmt{
+		rule:          rule,
+		query:         query,
+		keyParamIndex: findKeyParamIndex(query, rule.Key),
+		prepare:       prepare,
+		stmts:         make(map[string]*mysql.Stmt),
+	}
+}
+
+// findKeyParamIndex returns the 0-based position, among the query's `?`
+// placeholders, of the one bound to column key, by locating the first
+// "key ... ?" comparison in the query text. It returns -1 if key is
+// never paired with a placeholder (e.g. the query doesn't filter on the
+// shard key at all), in which case the statement fans out to every node
+// on every execute.
+//
+// This is a plain text scan rather than a SQL parser: good enough for
+// the equality and IN-list forms a sharding proxy needs to route on, and
+// it errs toward fanning out rather than guessing the wrong shard when
+// it isn't sure. Matches are required to fall on identifier boundaries,
+// so a key like "id" doesn't match inside "user_id" and lock onto the
+// wrong placeholder.
+func findKeyParamIndex(query, key string) int {
+	lower := strings.ToLower(query)
+	lowerKey := strings.ToLower(key)
+
+	from := 0
+	for {
+		rel := strings.Index(lower[from:], lowerKey)
+		if rel < 0 {
+			return -1
+		}
+		idx := from + rel
+
+		if !isIdentBoundary(lower, idx, len(lowerKey)) {
+			from = idx + len(lowerKey)
+			continue
+		}
+
+		rest := query[idx+len(key):]
+		q := strings.IndexByte(rest, '?')
+		if q < 0 {
+			return -1
+		}
+
+		// An IN (...) list binds several key values that may live on
+		// different shards, so it fans out instead of routing on the
+		// first one.
+		op := strings.TrimSpace(lower[idx+len(lowerKey) : idx+len(lowerKey)+q])
+		if strings.HasPrefix(op, "in") || strings.HasPrefix(op, "not in") {
+			return -1
+		}
+
+		return strings.Count(query[:idx+len(key)+q], "?")
+	}
+}
+
+// isIdentBoundary reports whether s[start:start+length] is flanked by
+// non-identifier characters (or the start/end of s) on both sides, i.e.
+// it isn't just the tail or a substring of some longer identifier.
+func isIdentBoundary(s string, start, length int) bool {
+	if start > 0 && isIdentByte(s[start-1]) {
+		return false
+	}
+
+	end := start + length
+	if end < len(s) && isIdentByte(s[end]) {
+		return false
+	}
+
+	return true
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' ||
+		(b >= '0' && b <= '9') ||
+		(b >= 'a' && b <= 'z') ||
+		(b >= 'A' && b <= 'Z')
+}
+
+func (ss *ShardedStmt) stmtFor(node string) (*mysql.Stmt, error) {
+	if s, ok := ss.stmts[node]; ok {
+		return s, nil
+	}
+
+	s, err := ss.prepare(node)
+	if err != nil {
+		return nil, err
+	}
+
+	ss.stmts[node] = s
+
+	return s, nil
+}
+
+// nodes resolves which backend(s) args must be sent to: the single node
+// rule.FindNode maps the key value to when the query binds a concrete
+// key, or every node the rule knows about when it doesn't (no
+// placeholder found for the key column, an IN (...) list on it, or a
+// NULL key argument).
+func (ss *ShardedStmt) nodes(args []interface{}) []string {
+	if ss.keyParamIndex < 0 || ss.keyParamIndex >= len(args) || args[ss.keyParamIndex] == nil {
+		return ss.rule.Nodes
+	}
+
+	return []string{ss.rule.FindNode(args[ss.keyParamIndex])}
+}
+
+// Exec runs args against every backend node nodes resolves to. Affected
+// rows are summed across shards; InsertId comes from the last shard
+// executed, since a multi-shard write's last-insert-id is inherently
+// ambiguous and single-shard writes (the common case) only ever hit one.
+func (ss *ShardedStmt) Exec(args ...interface{}) (*mysql.OKPacket, error) {
+	var result *mysql.OKPacket
+
+	for _, node := range ss.nodes(args) {
+		s, err := ss.stmtFor(node)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := s.Exec(args...)
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %v", node, err)
+		}
+
+		if result == nil {
+			result = r
+		} else {
+			result.AffectedRows += r.AffectedRows
+			result.InsertId = r.InsertId
+		}
+	}
+
+	return result, nil
+}
+
+// Query runs args against every backend node nodes resolves to and
+// merges their resultsets row-for-row. Binary row decoding, null bitmap
+// included, already happens inside mysql.Stmt.Query; merging is just
+// appending each shard's already-decoded Values, so a single-shard
+// lookup (the common case) does no merge work at all.
+func (ss *ShardedStmt) Query(args ...interface{}) (*mysql.Resultset, error) {
+	nodes := ss.nodes(args)
+
+	var merged *mysql.Resultset
+	for _, node := range nodes {
+		s, err := ss.stmtFor(node)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := s.Query(args...)
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %v", node, err)
+		}
+
+		if merged == nil {
+			merged = r
+		} else {
+			merged.Values = append(merged.Values, r.Values...)
+			merged.RowDatas = append(merged.RowDatas, r.RowDatas...)
+		}
+	}
+
+	return merged, nil
+}
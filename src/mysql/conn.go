@@ -0,0 +1,324 @@
+package mysql
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+)
+
+// conn is this package's end of a connection to a backend MySQL server:
+// it speaks the client side of the wire protocol, the mirror image of
+// server.Conn which speaks the server side against a connected client.
+type conn struct {
+	c  net.Conn
+	br *bufio.Reader
+
+	Sequence byte
+
+	stmts *stmtCache
+}
+
+// maxPacketSize is what this package advertises as its own limit on a
+// single packet during the handshake; large values (BLOB/TEXT params,
+// big result sets) go out in multiple packets instead, same as
+// Stmt.SendLongData already does on the way out.
+const maxPacketSize = 16 * 1024 * 1024
+
+// Dial connects to a MySQL server at addr (host:port) and authenticates
+// as user, selecting dbName if it's non-empty. It speaks protocol 41
+// with mysql_native_password, the auth method every server since 4.1
+// supports; it doesn't attempt CLIENT_SSL or any other auth plugin.
+func Dial(network, addr, user, password, dbName string) (*conn, error) {
+	nc, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &conn{
+		c:  nc,
+		br: bufio.NewReaderSize(nc, 16*1024),
+	}
+
+	if err := c.handshake(user, password, dbName); err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *conn) handshake(user, password, dbName string) error {
+	data, err := c.ReadPacket()
+	if err != nil {
+		return err
+	}
+
+	if data[0] == ERR_HEADER {
+		return LoadError(data)
+	}
+
+	seed, err := parseInitialHandshake(data)
+	if err != nil {
+		return err
+	}
+
+	capabilities := uint32(defaultClientCapabilities)
+	if dbName != "" {
+		capabilities |= CLIENT_CONNECT_WITH_DB
+	}
+
+	resp := buildHandshakeResponse(capabilities, user, password, dbName, seed)
+
+	c.Sequence = 1
+	if err := c.WritePacket(resp); err != nil {
+		return err
+	}
+
+	_, err = c.ReadOK()
+	return err
+}
+
+// parseInitialHandshake extracts the 20-byte auth seed from the
+// server's protocol-10 initial handshake packet (data still includes
+// the leading protocol-version byte).
+func parseInitialHandshake(data []byte) ([]byte, error) {
+	if len(data) < 1 || data[0] != 10 {
+		return nil, ErrMalformPacket
+	}
+	pos := 1
+
+	end := strings.IndexByte(string(data[pos:]), 0)
+	if end < 0 {
+		return nil, ErrMalformPacket
+	}
+	pos += end + 1
+
+	if len(data) < pos+4+8+1+2+1+2+2+1+10 {
+		return nil, ErrMalformPacket
+	}
+	pos += 4 // connection id
+
+	seed := make([]byte, 0, 20)
+	seed = append(seed, data[pos:pos+8]...)
+	pos += 8
+
+	pos++ // filler
+
+	pos += 2 // capability flags, lower 2 bytes
+	pos++    // character set
+	pos += 2 // status flags
+	pos += 2 // capability flags, upper 2 bytes
+
+	authPluginDataLen := int(data[pos])
+	pos++
+
+	pos += 10 // reserved
+
+	salt2Len := authPluginDataLen - 8
+	if salt2Len < 13 {
+		salt2Len = 13
+	}
+	if len(data) < pos+salt2Len {
+		return nil, ErrMalformPacket
+	}
+	salt2 := data[pos : pos+salt2Len]
+	// salt2 is null-terminated; drop that trailing byte.
+	if len(salt2) > 0 && salt2[len(salt2)-1] == 0 {
+		salt2 = salt2[:len(salt2)-1]
+	}
+	seed = append(seed, salt2...)
+
+	return seed, nil
+}
+
+// scramblePassword computes the mysql_native_password auth response:
+// SHA1(password) XOR SHA1(seed + SHA1(SHA1(password))). It never sends
+// password itself, only this one-way, per-connection scramble of it.
+func scramblePassword(password string, seed []byte) []byte {
+	if password == "" {
+		return nil
+	}
+
+	stage1 := sha1.Sum([]byte(password))
+
+	h := sha1.New()
+	h.Write(stage1[:])
+	stage2 := h.Sum(nil)
+
+	h = sha1.New()
+	h.Write(seed)
+	h.Write(stage2)
+	stage3 := h.Sum(nil)
+
+	scramble := make([]byte, len(stage3))
+	for i := range scramble {
+		scramble[i] = stage3[i] ^ stage1[i]
+	}
+
+	return scramble
+}
+
+func buildHandshakeResponse(capabilities uint32, user, password, dbName string, seed []byte) []byte {
+	scramble := scramblePassword(password, seed)
+
+	length := 4 + 4 + 1 + 23 + len(user) + 1 + 1 + len(scramble)
+	if dbName != "" {
+		length += len(dbName) + 1
+	}
+
+	data := make([]byte, 4, 4+length)
+
+	data = append(data, Uint32ToBytes(capabilities)...)
+	data = append(data, Uint32ToBytes(maxPacketSize)...)
+	data = append(data, defaultCharset)
+	data = append(data, make([]byte, 23)...)
+
+	data = append(data, user...)
+	data = append(data, 0)
+
+	data = append(data, byte(len(scramble)))
+	data = append(data, scramble...)
+
+	if dbName != "" {
+		data = append(data, dbName...)
+		data = append(data, 0)
+	}
+
+	return data
+}
+
+// ReadPacket reads one packet off the wire, stripping its 4-byte
+// header, and advances Sequence to match - the mirror image of
+// server.Conn.ReadPacket.
+func (c *conn) ReadPacket() ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c.br, header); err != nil {
+		return nil, err
+	}
+
+	length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+	c.Sequence = header[3] + 1
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.br, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// WritePacket writes data as one packet, filling in its 4-byte header
+// (data must already have 4 bytes of room at the front for it) and
+// advancing Sequence.
+func (c *conn) WritePacket(data []byte) error {
+	length := len(data) - 4
+
+	data[0] = byte(length)
+	data[1] = byte(length >> 8)
+	data[2] = byte(length >> 16)
+	data[3] = c.Sequence
+
+	c.Sequence++
+
+	_, err := c.c.Write(data)
+	return err
+}
+
+// WriteCommandUint32 sends a command byte followed by a 4-byte
+// little-endian argument, the shape COM_STMT_CLOSE and COM_STMT_RESET
+// both use (a statement id and nothing else).
+func (c *conn) WriteCommandUint32(cmd byte, arg uint32) error {
+	data := make([]byte, 4, 9)
+	data = append(data, cmd)
+	data = append(data, Uint32ToBytes(arg)...)
+
+	c.Sequence = 0
+	return c.WritePacket(data)
+}
+
+// WriteCommandStr sends a command byte followed by arg's raw bytes, the
+// shape COM_STMT_PREPARE and COM_QUERY both use (a command and a query
+// string, with no length prefix - the packet length says where it
+// ends).
+func (c *conn) WriteCommandStr(cmd byte, arg string) error {
+	data := make([]byte, 4, 5+len(arg))
+	data = append(data, cmd)
+	data = append(data, arg...)
+
+	c.Sequence = 0
+	return c.WritePacket(data)
+}
+
+// OKPacket is a server-side OK packet: a write's outcome, or (with
+// AffectedRows and InsertId left zero) the empty success ack a bare
+// command like a prepared Exec can also receive.
+type OKPacket struct {
+	AffectedRows uint64
+	InsertId     uint64
+	StatusFlags  uint16
+	Warnings     uint16
+}
+
+// ReadOK reads the next packet and requires it to be an OK packet,
+// returning the error it carries if the server sent an ERR packet
+// instead.
+func (c *conn) ReadOK() (*OKPacket, error) {
+	data, err := c.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	if data[0] == ERR_HEADER {
+		return nil, LoadError(data)
+	} else if data[0] != OK_HEADER {
+		return nil, ErrMalformPacket
+	}
+
+	return parseOK(data)
+}
+
+func parseOK(data []byte) (*OKPacket, error) {
+	pos := 1
+
+	affectedRows, _, n, err := readLengthEncodedInt(data[pos:])
+	if err != nil {
+		return nil, err
+	}
+	pos += n
+
+	insertId, _, n, err := readLengthEncodedInt(data[pos:])
+	if err != nil {
+		return nil, err
+	}
+	pos += n
+
+	if len(data) < pos+4 {
+		return nil, ErrMalformPacket
+	}
+
+	return &OKPacket{
+		AffectedRows: affectedRows,
+		InsertId:     insertId,
+		StatusFlags:  binary.LittleEndian.Uint16(data[pos:]),
+		Warnings:     binary.LittleEndian.Uint16(data[pos+2:]),
+	}, nil
+}
+
+// readUntilEOF drains packets up to and including the next EOF packet,
+// for the param/column definition blocks a COM_STMT_PREPARE response
+// carries, which this package doesn't otherwise need the contents of.
+func (c *conn) readUntilEOF() error {
+	for {
+		data, err := c.ReadPacket()
+		if err != nil {
+			return err
+		}
+
+		if data[0] == EOF_HEADER && len(data) < 9 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package mysql
+
+// Command bytes: the first byte of every packet a client sends the
+// server, naming which command the rest of the packet's payload belongs
+// to.
+const (
+	COM_SLEEP = iota
+	COM_QUIT
+	COM_INIT_DB
+	COM_QUERY
+	COM_FIELD_LIST
+	COM_CREATE_DB
+	COM_DROP_DB
+	COM_REFRESH
+	COM_SHUTDOWN
+	COM_STATISTICS
+	COM_PROCESS_INFO
+	COM_CONNECT
+	COM_PROCESS_KILL
+	COM_DEBUG
+	COM_PING
+	COM_TIME
+	COM_DELAYED_INSERT
+	COM_CHANGE_USER
+	COM_BINLOG_DUMP
+	COM_TABLE_DUMP
+	COM_CONNECT_OUT
+	COM_REGISTER_SLAVE
+	COM_STMT_PREPARE
+	COM_STMT_EXECUTE
+	COM_STMT_SEND_LONG_DATA
+	COM_STMT_CLOSE
+	COM_STMT_RESET
+	COM_SET_OPTION
+	COM_STMT_FETCH
+)
+
+// Response packet header bytes: the first byte of a server response
+// packet, distinguishing an OK/ERR/EOF packet from a result set's
+// column-count byte.
+const (
+	OK_HEADER  byte = 0x00
+	EOF_HEADER byte = 0xfe
+	ERR_HEADER byte = 0xff
+)
+
+// MYSQL_TYPE_* are the column/parameter type tags used throughout the
+// binary protocol (COM_STMT_EXECUTE parameter types, COM_STMT_PREPARE
+// column/param definitions). Values are fixed by the protocol: 0x00-0x10
+// are consecutive, and the 0xf6-0xff block below starts its own iota at
+// MYSQL_TYPE_NEWDECIMAL.
+const (
+	MYSQL_TYPE_DECIMAL byte = iota
+	MYSQL_TYPE_TINY
+	MYSQL_TYPE_SHORT
+	MYSQL_TYPE_LONG
+	MYSQL_TYPE_FLOAT
+	MYSQL_TYPE_DOUBLE
+	MYSQL_TYPE_NULL
+	MYSQL_TYPE_TIMESTAMP
+	MYSQL_TYPE_LONGLONG
+	MYSQL_TYPE_INT24
+	MYSQL_TYPE_DATE
+	MYSQL_TYPE_TIME
+	MYSQL_TYPE_DATETIME
+	MYSQL_TYPE_YEAR
+	MYSQL_TYPE_NEWDATE
+	MYSQL_TYPE_VARCHAR
+	MYSQL_TYPE_BIT
+)
+
+const (
+	MYSQL_TYPE_NEWDECIMAL byte = iota + 0xf6
+	MYSQL_TYPE_ENUM
+	MYSQL_TYPE_SET
+	MYSQL_TYPE_TINY_BLOB
+	MYSQL_TYPE_MEDIUM_BLOB
+	MYSQL_TYPE_LONG_BLOB
+	MYSQL_TYPE_BLOB
+	MYSQL_TYPE_VAR_STRING
+	MYSQL_TYPE_STRING
+	MYSQL_TYPE_GEOMETRY
+)
+
+// Client capability flags sent in the handshake response, the minimum
+// set this package's Dial needs to negotiate a protocol-41 connection
+// with an optional default database.
+const (
+	CLIENT_LONG_PASSWORD = 1 << iota
+	CLIENT_FOUND_ROWS
+	CLIENT_LONG_FLAG
+	CLIENT_CONNECT_WITH_DB
+	CLIENT_NO_SCHEMA
+	CLIENT_COMPRESS
+	CLIENT_ODBC
+	CLIENT_LOCAL_FILES
+	CLIENT_IGNORE_SPACE
+	CLIENT_PROTOCOL_41
+	CLIENT_INTERACTIVE
+	CLIENT_SSL
+	CLIENT_IGNORE_SIGPIPE
+	CLIENT_TRANSACTIONS
+	CLIENT_RESERVED
+	CLIENT_SECURE_CONNECTION
+	CLIENT_MULTI_STATEMENTS
+	CLIENT_MULTI_RESULTS
+)
+
+// UNSIGNED_FLAG marks a column definition's Flag as holding an unsigned
+// value, same meaning as the 0x80 bit write sets on a parameter's type
+// byte for unsigned Go argument types.
+const UNSIGNED_FLAG = 0x20
+
+// defaultCharset is utf8_general_ci, sent in the handshake response when
+// the caller didn't ask for a specific one.
+const defaultCharset = 33
+
+// defaultClientCapabilities is what Dial negotiates: protocol 41, a
+// scrambled (not plaintext) password, and the extras every server from
+// the last decade supports. CLIENT_CONNECT_WITH_DB is added only when
+// Dial is given a database name.
+const defaultClientCapabilities = CLIENT_PROTOCOL_41 |
+	CLIENT_LONG_PASSWORD |
+	CLIENT_LONG_FLAG |
+	CLIENT_SECURE_CONNECTION |
+	CLIENT_TRANSACTIONS
@@ -0,0 +1,55 @@
+package mysql
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrMalformPacket is returned when a packet is shorter than its own
+// encoding says it should be, or ends in the middle of a field - a
+// corrupt packet or a bug in the peer, never something a caller can
+// usefully retry.
+var ErrMalformPacket = errors.New("mysql: malformed packet")
+
+// Error is a server-side ERR packet: a MySQL error number and SQLSTATE
+// marker alongside the human-readable message.
+type Error struct {
+	Code    uint16
+	State   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ERROR %d (%s): %s", e.Code, e.State, e.Message)
+}
+
+// LoadError parses data as an ERR packet (the leading ERR_HEADER byte
+// still present). The SQLSTATE marker ('#' followed by a 5-character
+// state) is optional - older servers and COM_STMT_PREPARE errors before
+// MySQL 4.1 omit it - in which case State is left empty and the rest of
+// the packet is taken as Message.
+func LoadError(data []byte) error {
+	if len(data) < 3 {
+		return ErrMalformPacket
+	}
+
+	pos := 1
+	code := binary.LittleEndian.Uint16(data[pos:])
+	pos += 2
+
+	var state string
+	if pos < len(data) && data[pos] == '#' {
+		if len(data) < pos+6 {
+			return ErrMalformPacket
+		}
+		state = string(data[pos+1 : pos+6])
+		pos += 6
+	}
+
+	return &Error{
+		Code:    code,
+		State:   state,
+		Message: string(data[pos:]),
+	}
+}
@@ -0,0 +1,41 @@
+package mysql
+
+import "testing"
+
+func TestLoadErrorWithState(t *testing.T) {
+	data := append([]byte{ERR_HEADER}, Uint16ToBytes(1064)...)
+	data = append(data, "#42000"...)
+	data = append(data, "syntax error"...)
+
+	err := LoadError(data)
+	mysqlErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("got %T, want *Error", err)
+	}
+	if mysqlErr.Code != 1064 {
+		t.Errorf("Code = %d, want 1064", mysqlErr.Code)
+	}
+	if mysqlErr.State != "42000" {
+		t.Errorf("State = %q, want %q", mysqlErr.State, "42000")
+	}
+	if mysqlErr.Message != "syntax error" {
+		t.Errorf("Message = %q, want %q", mysqlErr.Message, "syntax error")
+	}
+}
+
+func TestLoadErrorWithoutState(t *testing.T) {
+	data := append([]byte{ERR_HEADER}, Uint16ToBytes(2013)...)
+	data = append(data, "server gone away"...)
+
+	err := LoadError(data)
+	mysqlErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("got %T, want *Error", err)
+	}
+	if mysqlErr.State != "" {
+		t.Errorf("State = %q, want empty", mysqlErr.State)
+	}
+	if mysqlErr.Message != "server gone away" {
+		t.Errorf("Message = %q, want %q", mysqlErr.Message, "server gone away")
+	}
+}
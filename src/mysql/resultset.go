@@ -0,0 +1,296 @@
+package mysql
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Field describes one result set column, decoded from its column
+// definition packet. Only what a caller needs to decode and route rows
+// by is kept; the catalog/schema/table-name parts of the packet are
+// read (to find where the next field starts) but discarded.
+type Field struct {
+	Name    string
+	Type    byte
+	Charset uint16
+	Flag    uint16
+}
+
+func parseField(data []byte) (*Field, error) {
+	pos := 0
+
+	// catalog, schema, table, org_table: always present, never used.
+	for i := 0; i < 4; i++ {
+		_, _, n, err := readLengthEncodedString(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+	}
+
+	name, _, n, err := readLengthEncodedString(data[pos:])
+	if err != nil {
+		return nil, err
+	}
+	pos += n
+
+	// org_name
+	_, _, n, err = readLengthEncodedString(data[pos:])
+	if err != nil {
+		return nil, err
+	}
+	pos += n
+
+	// length of the fixed fields below (always 0x0c), then charset(2),
+	// column length(4), type(1), flags(2), decimals(1), filler(2).
+	if len(data) < pos+1+12 {
+		return nil, ErrMalformPacket
+	}
+	pos++
+
+	f := &Field{
+		Name:    string(name),
+		Charset: binary.LittleEndian.Uint16(data[pos:]),
+	}
+	pos += 2 + 4
+
+	f.Type = data[pos]
+	pos++
+
+	f.Flag = binary.LittleEndian.Uint16(data[pos:])
+
+	return f, nil
+}
+
+// ResultsetPacket is a COM_STMT_EXECUTE/COM_QUERY result set as it came
+// off the wire: column definitions, their raw packets (for callers that
+// want to forward them to a client byte-for-byte rather than re-encode
+// them), and each row's raw, not yet decoded, packet.
+type ResultsetPacket struct {
+	Fields     []*Field
+	FieldDatas [][]byte
+	RowDatas   [][]byte
+}
+
+// readResultset reads a full result set: the column-count packet, one
+// column definition packet per column, the EOF terminating them, then
+// row packets up to the EOF (or ERR) that ends those.
+func (c *conn) readResultset() (*ResultsetPacket, error) {
+	data, err := c.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	if data[0] == ERR_HEADER {
+		return nil, LoadError(data)
+	}
+
+	colCount, _, _, err := readLengthEncodedInt(data)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]*Field, colCount)
+	fieldDatas := make([][]byte, colCount)
+
+	for i := range fields {
+		data, err := c.ReadPacket()
+		if err != nil {
+			return nil, err
+		}
+
+		fieldDatas[i] = data
+		fields[i], err = parseField(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if colCount > 0 {
+		if err := c.readUntilEOF(); err != nil {
+			return nil, err
+		}
+	}
+
+	var rowDatas [][]byte
+	for {
+		data, err := c.ReadPacket()
+		if err != nil {
+			return nil, err
+		}
+
+		if data[0] == EOF_HEADER && len(data) < 9 {
+			break
+		}
+		if data[0] == ERR_HEADER {
+			return nil, LoadError(data)
+		}
+
+		rowDatas = append(rowDatas, data)
+	}
+
+	return &ResultsetPacket{Fields: fields, FieldDatas: fieldDatas, RowDatas: rowDatas}, nil
+}
+
+// Resultset is a ResultsetPacket with every row decoded into Go values,
+// alongside the still-raw RowDatas a caller can forward unchanged.
+type Resultset struct {
+	Fields   []*Field
+	Values   [][]interface{}
+	RowDatas [][]byte
+}
+
+// Parse decodes every row in p. binaryProtocol selects COM_STMT_EXECUTE
+// row encoding (a leading null-bitmap, binary-typed values) over
+// COM_QUERY's plain length-encoded-string-per-column encoding; Stmt.Query
+// always passes true, since a prepared statement's results are always
+// binary-encoded.
+func (p *ResultsetPacket) Parse(binaryProtocol bool) (*Resultset, error) {
+	values := make([][]interface{}, len(p.RowDatas))
+
+	for i, row := range p.RowDatas {
+		var v []interface{}
+		var err error
+
+		if binaryProtocol {
+			v, err = decodeBinaryRow(row, p.Fields)
+		} else {
+			v, err = decodeTextRow(row, p.Fields)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		values[i] = v
+	}
+
+	return &Resultset{Fields: p.Fields, Values: values, RowDatas: p.RowDatas}, nil
+}
+
+// decodeBinaryRow decodes a COM_STMT_EXECUTE result row: a leading
+// 0x00 header byte, a null-bitmap offset by 2 bits (the protocol
+// reserves bits 0-1), then each non-null column's binary-typed value in
+// field order - the mirror image of the param encoding Stmt.write does
+// on the way out. Temporal columns (MYSQL_TYPE_DATETIME, MYSQL_TYPE_TIME
+// and the like), which Stmt.write can also encode, are not decoded:
+// decodeBinaryRow returns an error for them.
+func decodeBinaryRow(data []byte, fields []*Field) ([]interface{}, error) {
+	if len(data) < 1 {
+		return nil, ErrMalformPacket
+	}
+
+	nullBitmapLen := (len(fields) + 7 + 2) >> 3
+	if len(data) < 1+nullBitmapLen {
+		return nil, ErrMalformPacket
+	}
+	nullBitmap := data[1 : 1+nullBitmapLen]
+	pos := 1 + nullBitmapLen
+
+	values := make([]interface{}, len(fields))
+
+	for i, f := range fields {
+		bit := i + 2
+		if nullBitmap[bit/8]&(1<<(uint(bit)%8)) > 0 {
+			values[i] = nil
+			continue
+		}
+
+		v, n, err := decodeBinaryValue(f.Type, f.Flag&UNSIGNED_FLAG != 0, data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+		pos += n
+	}
+
+	return values, nil
+}
+
+func decodeBinaryValue(tp byte, unsigned bool, data []byte) (interface{}, int, error) {
+	switch tp {
+	case MYSQL_TYPE_NULL:
+		return nil, 0, nil
+	case MYSQL_TYPE_TINY:
+		if len(data) < 1 {
+			return nil, 0, ErrMalformPacket
+		}
+		if unsigned {
+			return uint8(data[0]), 1, nil
+		}
+		return int8(data[0]), 1, nil
+	case MYSQL_TYPE_SHORT, MYSQL_TYPE_YEAR:
+		if len(data) < 2 {
+			return nil, 0, ErrMalformPacket
+		}
+		v := binary.LittleEndian.Uint16(data)
+		if unsigned {
+			return v, 2, nil
+		}
+		return int16(v), 2, nil
+	case MYSQL_TYPE_LONG, MYSQL_TYPE_INT24:
+		if len(data) < 4 {
+			return nil, 0, ErrMalformPacket
+		}
+		v := binary.LittleEndian.Uint32(data)
+		if unsigned {
+			return v, 4, nil
+		}
+		return int32(v), 4, nil
+	case MYSQL_TYPE_LONGLONG:
+		if len(data) < 8 {
+			return nil, 0, ErrMalformPacket
+		}
+		v := binary.LittleEndian.Uint64(data)
+		if unsigned {
+			return v, 8, nil
+		}
+		return int64(v), 8, nil
+	case MYSQL_TYPE_FLOAT:
+		if len(data) < 4 {
+			return nil, 0, ErrMalformPacket
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(data)), 4, nil
+	case MYSQL_TYPE_DOUBLE:
+		if len(data) < 8 {
+			return nil, 0, ErrMalformPacket
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), 8, nil
+	case MYSQL_TYPE_STRING, MYSQL_TYPE_VAR_STRING, MYSQL_TYPE_VARCHAR,
+		MYSQL_TYPE_BLOB, MYSQL_TYPE_DECIMAL, MYSQL_TYPE_NEWDECIMAL:
+		v, isNull, n, err := readLengthEncodedString(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if isNull {
+			return nil, n, nil
+		}
+		return string(v), n, nil
+	default:
+		return nil, 0, fmt.Errorf("resultset: unsupported column type %d", tp)
+	}
+}
+
+// decodeTextRow decodes a COM_QUERY result row: every column, NULL or
+// not, as a length-encoded string - COM_QUERY never carries typed
+// binary values, leaving any conversion to the caller.
+func decodeTextRow(data []byte, fields []*Field) ([]interface{}, error) {
+	values := make([]interface{}, len(fields))
+	pos := 0
+
+	for i := range fields {
+		v, isNull, n, err := readLengthEncodedString(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+
+		if isNull {
+			values[i] = nil
+		} else {
+			values[i] = string(v)
+		}
+	}
+
+	return values, nil
+}
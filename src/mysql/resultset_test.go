@@ -0,0 +1,48 @@
+package mysql
+
+import "testing"
+
+func TestDecodeBinaryRow(t *testing.T) {
+	fields := []*Field{
+		{Name: "id", Type: MYSQL_TYPE_LONG},
+		{Name: "name", Type: MYSQL_TYPE_STRING},
+		{Name: "note", Type: MYSQL_TYPE_STRING},
+	}
+
+	// header(1) + null-bitmap((3+7+2)/8=1 byte, bit for "note" set) +
+	// id(4) + name(lenenc string)
+	row := []byte{0x00, 0x10}
+	row = append(row, Uint32ToBytes(42)...)
+	row = append(row, append(PutLengthEncodedInt(5), "hello"...)...)
+
+	values, err := decodeBinaryRow(row, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := values[0].(int32); !ok || got != 42 {
+		t.Errorf("id = %v (%T), want int32(42)", values[0], values[0])
+	}
+	if got, ok := values[1].(string); !ok || got != "hello" {
+		t.Errorf("name = %v (%T), want %q", values[1], values[1], "hello")
+	}
+	if values[2] != nil {
+		t.Errorf("note = %v, want nil (NULL)", values[2])
+	}
+}
+
+func TestDecodeBinaryRowUnsigned(t *testing.T) {
+	fields := []*Field{{Name: "n", Type: MYSQL_TYPE_LONG, Flag: UNSIGNED_FLAG}}
+
+	row := []byte{0x00, 0x00}
+	row = append(row, Uint32ToBytes(4000000000)...)
+
+	values, err := decodeBinaryRow(row, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := values[0].(uint32); !ok || got != 4000000000 {
+		t.Errorf("n = %v (%T), want uint32(4000000000)", values[0], values[0])
+	}
+}
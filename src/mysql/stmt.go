@@ -3,7 +3,10 @@ package mysql
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
+	"strconv"
+	"time"
 )
 
 type Stmt struct {
@@ -12,6 +15,92 @@ type Stmt struct {
 	query   string
 	columns uint16
 	params  uint16
+
+	boundTypes map[int]byte
+	sentLong   map[uint16]bool
+	closed     bool
+}
+
+// sendLongDataChunkSize bounds each COM_STMT_SEND_LONG_DATA packet well
+// under the 16MB single-packet limit, so SendLongData never has to deal
+// with splitting a chunk across multiple packets itself.
+const sendLongDataChunkSize = 4 << 20
+
+// SendLongData streams r to the server as paramIndex's value via one or
+// more COM_STMT_SEND_LONG_DATA packets, for parameters too large to hand
+// to write/Exec/Query in one piece (e.g. BLOB/TEXT columns). Call it
+// before the Exec/Query/RawQuery call it belongs to; write then leaves
+// that parameter's bytes out of the execute packet entirely.
+func (s *Stmt) SendLongData(paramIndex uint16, r io.Reader) error {
+	buf := make([]byte, sendLongDataChunkSize)
+	sent := false
+
+	for {
+		n, err := r.Read(buf)
+		if n > 0 || !sent {
+			// Always send at least one packet, even an empty one: a
+			// reader that's empty from the start (a valid, if unusual,
+			// io.Reader outcome for e.g. a zero-length BLOB) must still
+			// reach the server, since write leaves the param's value out
+			// of the execute packet either way.
+			data := make([]byte, 4, 4+7+n)
+			data = append(data, COM_STMT_SEND_LONG_DATA)
+			data = append(data, byte(s.id), byte(s.id>>8), byte(s.id>>16), byte(s.id>>24))
+			data = append(data, byte(paramIndex), byte(paramIndex>>8))
+			data = append(data, buf[:n]...)
+
+			s.conn.Sequence = 0
+			if werr := s.conn.WritePacket(data); werr != nil {
+				return werr
+			}
+			sent = true
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if s.sentLong == nil {
+		s.sentLong = make(map[uint16]bool)
+	}
+	s.sentLong[paramIndex] = true
+
+	return nil
+}
+
+// Reset issues COM_STMT_RESET, clearing any COM_STMT_SEND_LONG_DATA
+// state so the statement can be re-executed with fresh parameter values.
+func (s *Stmt) Reset() error {
+	if err := s.conn.WriteCommandUint32(COM_STMT_RESET, s.id); err != nil {
+		return err
+	}
+
+	if _, err := s.conn.ReadOK(); err != nil {
+		return err
+	}
+
+	s.sentLong = nil
+
+	return nil
+}
+
+// Decimal is a string alias for values that must go out as
+// MYSQL_TYPE_NEWDECIMAL rather than MYSQL_TYPE_STRING, e.g. money
+// columns where client-side float rounding isn't acceptable.
+type Decimal string
+
+// BindType overrides the MySQL type write infers for argument i. Most
+// callers never need this, but some queries (e.g. `WHERE dt = ?` against
+// a column that isn't quite a DATETIME) need the wire type to be
+// something the Go type switch in write can't guess on its own.
+func (s *Stmt) BindType(i int, mysqlType byte) {
+	if s.boundTypes == nil {
+		s.boundTypes = make(map[int]byte)
+	}
+	s.boundTypes[i] = mysqlType
 }
 
 func (s *Stmt) Exec(args ...interface{}) (*OKPacket, error) {
@@ -39,14 +128,32 @@ func (s *Stmt) RawQuery(args ...interface{}) (*ResultsetPacket, error) {
 	return s.conn.readResultset()
 }
 
+// Close sends COM_STMT_CLOSE for s and drops it from the connection's
+// statement cache. It's idempotent and safe to call more than once,
+// including from a deferred call after s has already been evicted from
+// the cache or explicitly closed earlier.
 func (s *Stmt) Close() error {
-	delete(s.conn.stmts, s.query)
+	if s.closed {
+		return nil
+	}
+	s.closed = true
 
-	if err := s.conn.WriteCommandUint32(COM_STMT_CLOSE, s.id); err != nil {
-		return err
+	if s.conn.stmts != nil {
+		s.conn.stmts.remove(s.query)
 	}
 
-	return nil
+	return s.conn.WriteCommandUint32(COM_STMT_CLOSE, s.id)
+}
+
+// closeForEviction is Close without the cache removal, for statements
+// the cache has already evicted itself.
+func (s *Stmt) closeForEviction() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	return s.conn.WriteCommandUint32(COM_STMT_CLOSE, s.id)
 }
 
 func (s *Stmt) write(args ...interface{}) error {
@@ -63,6 +170,17 @@ func (s *Stmt) write(args ...interface{}) error {
 	var length int = int(1 + 4 + 1 + 4 + ((s.params + 7) >> 3) + 1 + (s.params << 1))
 
 	for i := range args {
+		if s.sentLong[uint16(i)] {
+			// Value was already streamed via SendLongData: the type byte
+			// still goes out, but the value area and null-bitmap bit for
+			// this param are left untouched.
+			paramTypes[i<<1] = MYSQL_TYPE_BLOB
+			if tp, ok := s.boundTypes[i]; ok {
+				paramTypes[i<<1] = tp
+			}
+			continue
+		}
+
 		if args[i] == nil {
 			nullBitmap[i/8] |= (1 << (uint(i) % 8))
 			paramTypes[i<<1] = MYSQL_TYPE_NULL
@@ -80,8 +198,13 @@ func (s *Stmt) write(args ...interface{}) error {
 			paramTypes[i<<1] = MYSQL_TYPE_LONG
 			paramValues[i] = Uint32ToBytes(uint32(v))
 		case int:
-			paramTypes[i<<1] = MYSQL_TYPE_LONGLONG
-			paramValues[i] = Uint64ToBytes(uint64(v))
+			if strconv.IntSize == 32 {
+				paramTypes[i<<1] = MYSQL_TYPE_LONG
+				paramValues[i] = Uint32ToBytes(uint32(v))
+			} else {
+				paramTypes[i<<1] = MYSQL_TYPE_LONGLONG
+				paramValues[i] = Uint64ToBytes(uint64(v))
+			}
 		case int64:
 			paramTypes[i<<1] = MYSQL_TYPE_LONGLONG
 			paramValues[i] = Uint64ToBytes(uint64(v))
@@ -107,6 +230,7 @@ func (s *Stmt) write(args ...interface{}) error {
 			paramValues[i] = Uint64ToBytes(uint64(v))
 		case bool:
 			paramTypes[i<<1] = MYSQL_TYPE_TINY
+			paramTypes[(i<<1)+1] = 0x80
 			if v {
 				paramValues[i] = []byte{1}
 			} else {
@@ -125,10 +249,23 @@ func (s *Stmt) write(args ...interface{}) error {
 		case []byte:
 			paramTypes[i<<1] = MYSQL_TYPE_STRING
 			paramValues[i] = append(PutLengthEncodedInt(uint64(len(v))), v...)
+		case Decimal:
+			paramTypes[i<<1] = MYSQL_TYPE_NEWDECIMAL
+			paramValues[i] = append(PutLengthEncodedInt(uint64(len(v))), v...)
+		case time.Time:
+			paramTypes[i<<1] = MYSQL_TYPE_DATETIME
+			paramValues[i] = dumpDatetime(v)
+		case time.Duration:
+			paramTypes[i<<1] = MYSQL_TYPE_TIME
+			paramValues[i] = dumpDuration(v)
 		default:
 			return fmt.Errorf("invalid argument type %T", args[i])
 		}
 
+		if tp, ok := s.boundTypes[i]; ok {
+			paramTypes[i<<1] = tp
+		}
+
 		length += len(paramValues[i])
 	}
 
@@ -164,7 +301,11 @@ func (s *Stmt) write(args ...interface{}) error {
 }
 
 func (c *conn) Prepare(query string) (*Stmt, error) {
-	if s, ok := c.stmts[query]; ok {
+	if c.stmts == nil {
+		c.stmts = newStmtCache(DefaultStmtCacheSize)
+	}
+
+	if s, ok := c.stmts.get(query); ok {
 		return s, nil
 	}
 
@@ -217,7 +358,85 @@ func (c *conn) Prepare(query string) (*Stmt, error) {
 		}
 	}
 
-	c.stmts[query] = s
+	if evicted := c.stmts.put(query, s); evicted != nil {
+		// s is already prepared and already cached; a failure closing
+		// some other, evicted statement is unrelated and shouldn't fail
+		// this Prepare. Note it in Stats instead.
+		if err := evicted.closeForEviction(); err != nil {
+			c.stmts.recordEvictionCloseErr()
+		}
+	}
 
 	return s, nil
-}
\ No newline at end of file
+}
+
+// dumpDatetime encodes t as a MYSQL_TYPE_DATETIME binary parameter body,
+// length-prefixed and trimmed to the shortest of the protocol's 0/4/7/11
+// byte forms: an all-zero time sends as just the length byte, a midnight
+// time omits the hour/minute/second, and a time with no fractional
+// seconds omits the microseconds.
+func dumpDatetime(t time.Time) []byte {
+	if t.IsZero() {
+		return []byte{0}
+	}
+
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	nsec := t.Nanosecond()
+
+	data := make([]byte, 1, 12)
+
+	data = append(data, Uint16ToBytes(uint16(year))...)
+	data = append(data, byte(month), byte(day))
+
+	if hour == 0 && min == 0 && sec == 0 && nsec == 0 {
+		data[0] = byte(len(data) - 1)
+		return data
+	}
+
+	data = append(data, byte(hour), byte(min), byte(sec))
+
+	if nsec != 0 {
+		data = append(data, Uint32ToBytes(uint32(nsec/1000))...)
+	}
+
+	data[0] = byte(len(data) - 1)
+	return data
+}
+
+// dumpDuration encodes d as a MYSQL_TYPE_TIME binary parameter body,
+// trimmed to the protocol's 0/8/12 byte forms the same way dumpDatetime
+// trims MYSQL_TYPE_DATETIME.
+func dumpDuration(d time.Duration) []byte {
+	if d == 0 {
+		return []byte{0}
+	}
+
+	sign := byte(0)
+	if d < 0 {
+		sign = 1
+		d = -d
+	}
+
+	days := uint32(d / (24 * time.Hour))
+	d -= time.Duration(days) * 24 * time.Hour
+	hour := byte(d / time.Hour)
+	d -= time.Duration(hour) * time.Hour
+	min := byte(d / time.Minute)
+	d -= time.Duration(min) * time.Minute
+	sec := byte(d / time.Second)
+	d -= time.Duration(sec) * time.Second
+	usec := uint32(d / time.Microsecond)
+
+	data := make([]byte, 1, 12)
+	data = append(data, sign)
+	data = append(data, Uint32ToBytes(days)...)
+	data = append(data, hour, min, sec)
+
+	if usec != 0 {
+		data = append(data, Uint32ToBytes(usec)...)
+	}
+
+	data[0] = byte(len(data) - 1)
+	return data
+}
@@ -0,0 +1,131 @@
+package mysql
+
+import "container/list"
+
+// DefaultStmtCacheSize is how many prepared statements conn.stmts keeps
+// before evicting the least recently used one.
+const DefaultStmtCacheSize = 256
+
+// stmtCache is a bounded, query-string-keyed LRU of prepared statements.
+// Long-running proxy connections used to stash every prepared statement
+// in a plain map forever, accumulating server-side statement handles
+// until MySQL's max_prepared_stmt_count was exceeded; put now reports
+// the least recently used entry once the cache is over size so the
+// caller can send COM_STMT_CLOSE for it before it's dropped.
+type stmtCache struct {
+	size int
+	ll   *list.List
+	m    map[string]*list.Element
+
+	hits             uint64
+	misses           uint64
+	evictions        uint64
+	evictionCloseErr uint64
+}
+
+type stmtCacheEntry struct {
+	query string
+	stmt  *Stmt
+}
+
+func newStmtCache(size int) *stmtCache {
+	if size <= 0 {
+		size = DefaultStmtCacheSize
+	}
+
+	return &stmtCache{
+		size: size,
+		ll:   list.New(),
+		m:    make(map[string]*list.Element),
+	}
+}
+
+func (c *stmtCache) get(query string) (*Stmt, bool) {
+	e, ok := c.m[query]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	c.hits++
+	c.ll.MoveToFront(e)
+
+	return e.Value.(*stmtCacheEntry).stmt, true
+}
+
+// put adds s under query, returning the least recently used statement if
+// the cache is now over size so the caller can close it. It returns nil
+// when nothing needed to be evicted.
+func (c *stmtCache) put(query string, s *Stmt) *Stmt {
+	if e, ok := c.m[query]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*stmtCacheEntry).stmt = s
+		return nil
+	}
+
+	e := c.ll.PushFront(&stmtCacheEntry{query: query, stmt: s})
+	c.m[query] = e
+
+	if c.ll.Len() <= c.size {
+		return nil
+	}
+
+	back := c.ll.Back()
+	c.ll.Remove(back)
+
+	evicted := back.Value.(*stmtCacheEntry)
+	delete(c.m, evicted.query)
+	c.evictions++
+
+	return evicted.stmt
+}
+
+func (c *stmtCache) remove(query string) {
+	e, ok := c.m[query]
+	if !ok {
+		return
+	}
+
+	c.ll.Remove(e)
+	delete(c.m, query)
+}
+
+// recordEvictionCloseErr notes that closing an evicted statement failed.
+// This doesn't fail the Prepare that triggered the eviction - that
+// Prepare already succeeded, and the eviction is an unrelated,
+// best-effort cleanup - it just shows up in Stats for callers who care.
+func (c *stmtCache) recordEvictionCloseErr() {
+	c.evictionCloseErr++
+}
+
+// Stats reports how a connection's prepared statement cache has been
+// behaving, for callers that want visibility before they hit
+// max_prepared_stmt_count in production.
+type Stats struct {
+	StmtCacheHits             uint64
+	StmtCacheMisses           uint64
+	StmtCacheEvictions        uint64
+	StmtCacheEvictionCloseErr uint64
+}
+
+func (c *conn) Stats() Stats {
+	if c.stmts == nil {
+		return Stats{}
+	}
+
+	return Stats{
+		StmtCacheHits:             c.stmts.hits,
+		StmtCacheMisses:           c.stmts.misses,
+		StmtCacheEvictions:        c.stmts.evictions,
+		StmtCacheEvictionCloseErr: c.stmts.evictionCloseErr,
+	}
+}
+
+// SetStmtCacheSize sets how many prepared statements this connection's
+// cache keeps before evicting the least recently used one. Call it
+// right after dialing, before the first Prepare, to use something other
+// than DefaultStmtCacheSize; calling it later replaces the cache (and
+// loses whatever it held).
+func (c *conn) SetStmtCacheSize(size int) {
+	c.stmts = newStmtCache(size)
+}
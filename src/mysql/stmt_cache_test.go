@@ -0,0 +1,96 @@
+package mysql
+
+import "testing"
+
+func TestStmtCacheGetMiss(t *testing.T) {
+	c := newStmtCache(2)
+
+	if _, ok := c.get("select 1"); ok {
+		t.Fatal("expected miss on empty cache")
+	}
+	if c.misses != 1 {
+		t.Fatalf("misses = %d, want 1", c.misses)
+	}
+}
+
+func TestStmtCacheGetHit(t *testing.T) {
+	c := newStmtCache(2)
+	s := &Stmt{query: "select 1"}
+
+	if evicted := c.put("select 1", s); evicted != nil {
+		t.Fatal("expected no eviction below size")
+	}
+
+	got, ok := c.get("select 1")
+	if !ok || got != s {
+		t.Fatalf("get(%q) = %v, %v; want %v, true", "select 1", got, ok, s)
+	}
+	if c.hits != 1 {
+		t.Fatalf("hits = %d, want 1", c.hits)
+	}
+}
+
+func TestStmtCachePutReplacesExisting(t *testing.T) {
+	c := newStmtCache(2)
+	s1 := &Stmt{query: "select 1"}
+	s2 := &Stmt{query: "select 1"}
+
+	c.put("select 1", s1)
+	if evicted := c.put("select 1", s2); evicted != nil {
+		t.Fatal("replacing an existing entry must not evict")
+	}
+
+	got, _ := c.get("select 1")
+	if got != s2 {
+		t.Fatalf("get returned %v, want the replacement %v", got, s2)
+	}
+}
+
+func TestStmtCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newStmtCache(2)
+	s1 := &Stmt{query: "q1"}
+	s2 := &Stmt{query: "q2"}
+	s3 := &Stmt{query: "q3"}
+
+	c.put("q1", s1)
+	c.put("q2", s2)
+
+	// touch q1 so q2 becomes the least recently used entry
+	c.get("q1")
+
+	evicted := c.put("q3", s3)
+	if evicted != s2 {
+		t.Fatalf("evicted %v, want %v", evicted, s2)
+	}
+	if c.evictions != 1 {
+		t.Fatalf("evictions = %d, want 1", c.evictions)
+	}
+
+	if _, ok := c.get("q2"); ok {
+		t.Fatal("q2 should have been evicted")
+	}
+	if _, ok := c.get("q1"); !ok {
+		t.Fatal("q1 should still be cached")
+	}
+	if _, ok := c.get("q3"); !ok {
+		t.Fatal("q3 should be cached")
+	}
+}
+
+func TestStmtCacheRemove(t *testing.T) {
+	c := newStmtCache(2)
+	c.put("q1", &Stmt{query: "q1"})
+
+	c.remove("q1")
+
+	if _, ok := c.get("q1"); ok {
+		t.Fatal("expected miss after remove")
+	}
+}
+
+func TestNewStmtCacheDefaultsNonPositiveSize(t *testing.T) {
+	c := newStmtCache(0)
+	if c.size != DefaultStmtCacheSize {
+		t.Fatalf("size = %d, want %d", c.size, DefaultStmtCacheSize)
+	}
+}
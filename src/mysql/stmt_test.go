@@ -0,0 +1,50 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDumpDatetime(t *testing.T) {
+	cases := []struct {
+		name string
+		t    time.Time
+		len  int
+	}{
+		{"zero value", time.Time{}, 1},
+		{"date only", time.Date(2014, 9, 21, 0, 0, 0, 0, time.UTC), 5},
+		{"date and time", time.Date(2014, 9, 21, 10, 11, 12, 0, time.UTC), 8},
+		{"date, time and micros", time.Date(2014, 9, 21, 10, 11, 12, 123456000, time.UTC), 12},
+	}
+
+	for _, c := range cases {
+		if got := len(dumpDatetime(c.t)); got != c.len {
+			t.Errorf("%s: got length %d, want %d", c.name, got, c.len)
+		}
+	}
+}
+
+func TestDumpDuration(t *testing.T) {
+	cases := []struct {
+		name string
+		d    time.Duration
+		len  int
+	}{
+		{"zero", 0, 1},
+		{"hms only", 10*time.Hour + 11*time.Minute + 12*time.Second, 9},
+		{"negative hms", -(10*time.Hour + 11*time.Minute + 12*time.Second), 9},
+		{"with micros", 10*time.Hour + 11*time.Minute + 12*time.Second + 123456*time.Microsecond, 13},
+		{"with days", 30*24*time.Hour + time.Hour, 9},
+	}
+
+	for _, c := range cases {
+		data := dumpDuration(c.d)
+		if got := len(data); got != c.len {
+			t.Errorf("%s: got length %d, want %d", c.name, got, c.len)
+		}
+
+		if c.d < 0 && data[1] != 1 {
+			t.Errorf("%s: sign byte = %d, want 1", c.name, data[1])
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package mysql
+
+import "encoding/binary"
+
+// Uint16ToBytes encodes n as 2 little-endian bytes, the fixed-length
+// integer form the binary protocol uses for things like a parameter's
+// MYSQL_TYPE_SHORT value.
+func Uint16ToBytes(n uint16) []byte {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, n)
+	return b
+}
+
+// Uint32ToBytes encodes n as 4 little-endian bytes.
+func Uint32ToBytes(n uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, n)
+	return b
+}
+
+// Uint64ToBytes encodes n as 8 little-endian bytes.
+func Uint64ToBytes(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, n)
+	return b
+}
+
+// PutLengthEncodedInt encodes n as a length-encoded integer: the
+// shortest of the protocol's 1/3/4/9 byte forms that can hold it, used
+// to prefix every length-encoded string (query parameters, column
+// values, column/table name fields) with its byte length.
+func PutLengthEncodedInt(n uint64) []byte {
+	switch {
+	case n < 251:
+		return []byte{byte(n)}
+	case n < 1<<16:
+		return []byte{0xfc, byte(n), byte(n >> 8)}
+	case n < 1<<24:
+		return []byte{0xfd, byte(n), byte(n >> 8), byte(n >> 16)}
+	default:
+		b := make([]byte, 9)
+		b[0] = 0xfe
+		binary.LittleEndian.PutUint64(b[1:], n)
+		return b
+	}
+}
+
+// readLengthEncodedInt decodes a length-encoded integer from the front
+// of data, returning its value, whether it was the SQL NULL marker
+// (0xfb, value meaningless), and how many bytes it occupied.
+func readLengthEncodedInt(data []byte) (value uint64, isNull bool, n int, err error) {
+	if len(data) == 0 {
+		return 0, false, 0, ErrMalformPacket
+	}
+
+	switch data[0] {
+	case 0xfb:
+		return 0, true, 1, nil
+	case 0xfc:
+		if len(data) < 3 {
+			return 0, false, 0, ErrMalformPacket
+		}
+		return uint64(binary.LittleEndian.Uint16(data[1:3])), false, 3, nil
+	case 0xfd:
+		if len(data) < 4 {
+			return 0, false, 0, ErrMalformPacket
+		}
+		return uint64(data[1]) | uint64(data[2])<<8 | uint64(data[3])<<16, false, 4, nil
+	case 0xfe:
+		if len(data) < 9 {
+			return 0, false, 0, ErrMalformPacket
+		}
+		return binary.LittleEndian.Uint64(data[1:9]), false, 9, nil
+	default:
+		return uint64(data[0]), false, 1, nil
+	}
+}
+
+// readLengthEncodedString decodes a length-encoded string from the
+// front of data, returning its bytes, whether it was the SQL NULL
+// marker, and how many bytes (length prefix plus payload) it occupied.
+func readLengthEncodedString(data []byte) (value []byte, isNull bool, n int, err error) {
+	length, isNull, prefixLen, err := readLengthEncodedInt(data)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	if isNull {
+		return nil, true, prefixLen, nil
+	}
+
+	total := prefixLen + int(length)
+	if len(data) < total {
+		return nil, false, 0, ErrMalformPacket
+	}
+
+	return data[prefixLen:total], false, total, nil
+}
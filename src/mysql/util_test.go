@@ -0,0 +1,83 @@
+package mysql
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLengthEncodedIntRoundTrip(t *testing.T) {
+	cases := []uint64{0, 250, 251, 1<<16 - 1, 1 << 16, 1<<24 - 1, 1 << 24, 1<<32 + 7}
+
+	for _, n := range cases {
+		encoded := PutLengthEncodedInt(n)
+
+		got, isNull, consumed, err := readLengthEncodedInt(encoded)
+		if err != nil {
+			t.Errorf("n=%d: %v", n, err)
+			continue
+		}
+		if isNull {
+			t.Errorf("n=%d: got isNull, want a value", n)
+			continue
+		}
+		if got != n {
+			t.Errorf("n=%d: round-tripped to %d", n, got)
+		}
+		if consumed != len(encoded) {
+			t.Errorf("n=%d: consumed %d bytes, encoding is %d long", n, consumed, len(encoded))
+		}
+	}
+}
+
+func TestReadLengthEncodedIntNull(t *testing.T) {
+	_, isNull, n, err := readLengthEncodedInt([]byte{0xfb, 'x'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isNull {
+		t.Fatal("expected isNull")
+	}
+	if n != 1 {
+		t.Fatalf("consumed %d bytes, want 1", n)
+	}
+}
+
+func TestReadLengthEncodedString(t *testing.T) {
+	want := "hello world"
+	data := append(PutLengthEncodedInt(uint64(len(want))), want...)
+	data = append(data, "trailing garbage"...)
+
+	got, isNull, n, err := readLengthEncodedString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isNull {
+		t.Fatal("expected a value, not NULL")
+	}
+	if string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if n != 1+len(want) {
+		t.Fatalf("consumed %d bytes, want %d", n, 1+len(want))
+	}
+}
+
+func TestReadLengthEncodedStringTruncated(t *testing.T) {
+	data := append(PutLengthEncodedInt(10), "short"...)
+
+	if _, _, _, err := readLengthEncodedString(data); err != ErrMalformPacket {
+		t.Fatalf("got err %v, want ErrMalformPacket", err)
+	}
+}
+
+func TestUintToBytesLittleEndian(t *testing.T) {
+	if got := Uint16ToBytes(0x0102); !bytes.Equal(got, []byte{0x02, 0x01}) {
+		t.Fatalf("Uint16ToBytes = % x", got)
+	}
+	if got := Uint32ToBytes(0x01020304); !bytes.Equal(got, []byte{0x04, 0x03, 0x02, 0x01}) {
+		t.Fatalf("Uint32ToBytes = % x", got)
+	}
+	if got := Uint64ToBytes(0x0102030405060708); !bytes.Equal(got, []byte{0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}) {
+		t.Fatalf("Uint64ToBytes = % x", got)
+	}
+}
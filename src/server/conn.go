@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+
+	"github.com/siddontang/mixer/src/mysql"
+)
+
+// Conn is the proxy's end of a client connection: it speaks the server
+// side of the MySQL wire protocol, the mirror image of mysql.conn which
+// speaks the client side against a backend.
+type Conn struct {
+	c  net.Conn
+	br *bufio.Reader
+
+	Sequence byte
+
+	stmtID uint32
+	stmts  map[uint32]*Stmt
+}
+
+func NewConn(c net.Conn) *Conn {
+	return &Conn{
+		c:     c,
+		br:    bufio.NewReaderSize(c, 16*1024),
+		stmts: make(map[uint32]*Stmt),
+	}
+}
+
+func (c *Conn) ReadPacket() ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c.br, header); err != nil {
+		return nil, err
+	}
+
+	length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+	c.Sequence = header[3] + 1
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.br, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (c *Conn) WritePacket(data []byte) error {
+	length := len(data) - 4
+
+	data[0] = byte(length)
+	data[1] = byte(length >> 8)
+	data[2] = byte(length >> 16)
+	data[3] = c.Sequence
+
+	c.Sequence++
+
+	_, err := c.c.Write(data)
+	return err
+}
+
+func (c *Conn) nextStmtID() uint32 {
+	c.stmtID++
+	return c.stmtID
+}
+
+// writeOK answers a command with a bare, zero-value OK packet: no rows
+// affected, no insert id, no warnings.
+func (c *Conn) writeOK() error {
+	data := make([]byte, 4, 11)
+
+	data = append(data, mysql.OK_HEADER)
+	data = append(data, 0)    // affected rows, lenenc 0
+	data = append(data, 0)    // insert id, lenenc 0
+	data = append(data, 0, 0) // status flags
+	data = append(data, 0, 0) // warnings
+
+	return c.WritePacket(data)
+}
@@ -0,0 +1,499 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/siddontang/mixer/router"
+	"github.com/siddontang/mixer/src/mysql"
+)
+
+// Stmt is a prepared statement the proxy has allocated an id for on behalf
+// of a connected client. It answers COM_STMT_PREPARE/COM_STMT_EXECUTE,
+// the mirror image of mysql.Stmt which issues them against a backend.
+type Stmt struct {
+	ID      uint32
+	Query   string
+	Params  []*Field
+	Columns []*Field
+
+	// Args holds the decoded parameter values from the most recent
+	// COM_STMT_EXECUTE, in positional order, ready for a router or query
+	// handler to act on.
+	Args []interface{}
+
+	// Sharded is non-nil when Query was prepared against a sharded
+	// table (see PrepareSharded): dispatchStmt then runs each
+	// COM_STMT_EXECUTE against the backend node(s) Sharded resolves
+	// to and answers the client directly, instead of just decoding
+	// Args for some other handler to act on.
+	Sharded *router.ShardedStmt
+
+	paramTypes []byte
+	sentLong   map[uint16]bool
+	longData   map[uint16][]byte
+}
+
+// appendLongData records a COM_STMT_SEND_LONG_DATA chunk for paramIndex,
+// appending to whatever has arrived for it already: a client may split
+// one param's value across several SEND_LONG_DATA calls.
+func (s *Stmt) appendLongData(paramIndex uint16, chunk []byte) {
+	if s.longData == nil {
+		s.longData = make(map[uint16][]byte)
+	}
+	s.longData[paramIndex] = append(s.longData[paramIndex], chunk...)
+	s.sentLong[paramIndex] = true
+}
+
+// resetLongData clears everything SEND_LONG_DATA has accumulated, as
+// COM_STMT_RESET requires.
+func (s *Stmt) resetLongData() {
+	s.sentLong = make(map[uint16]bool)
+	s.longData = nil
+}
+
+// Field describes one column or parameter definition sent as part of a
+// COM_STMT_PREPARE response. Column length is left at 0 and decimals at 0
+// since the proxy does not know backend schema details at prepare time.
+type Field struct {
+	Name    string
+	Type    byte
+	Charset uint16
+	Flag    uint16
+}
+
+func (f *Field) dump() []byte {
+	data := make([]byte, 0, 48+len(f.Name)*2)
+
+	data = append(data, lengthEncodedString("def")...)
+	data = append(data, lengthEncodedString("")...) // schema
+	data = append(data, lengthEncodedString("")...) // table
+	data = append(data, lengthEncodedString("")...) // org_table
+	data = append(data, lengthEncodedString(f.Name)...)
+	data = append(data, lengthEncodedString(f.Name)...) // org_name
+
+	data = append(data, 0x0c) // length of the fixed fields below
+
+	data = append(data, mysql.Uint16ToBytes(f.Charset)...)
+	data = append(data, mysql.Uint32ToBytes(uint32(0))...) // column length
+	data = append(data, f.Type)
+	data = append(data, mysql.Uint16ToBytes(f.Flag)...)
+	data = append(data, 0)    // decimals
+	data = append(data, 0, 0) // filler
+
+	return data
+}
+
+func lengthEncodedString(s string) []byte {
+	return append(mysql.PutLengthEncodedInt(uint64(len(s))), s...)
+}
+
+// prepare answers a COM_STMT_PREPARE for query, given the params and
+// columns a router or query handler has already worked out for it (this
+// package has no SQL parser of its own), and registers the resulting
+// statement for later COM_STMT_EXECUTE/COM_STMT_CLOSE calls.
+func (c *Conn) prepare(query string, params []*Field, columns []*Field) (*Stmt, error) {
+	return c.prepareStmt(query, params, columns, nil)
+}
+
+// PrepareSharded is like prepare, but for a query against a sharded
+// table: rule resolves which backend node(s) a shard key value maps
+// to, and prepareBackend lazily prepares query against a node the
+// first time an execute actually needs it - the same contract
+// router.NewShardedStmt expects, since it's what builds the resulting
+// statement's routing. Each later COM_STMT_EXECUTE runs against
+// whichever backend(s) that resolves to and answers the client
+// directly; the caller never sees the decoded Args itself.
+func (c *Conn) PrepareSharded(rule *router.Rule, query string, prepareBackend func(node string) (*mysql.Stmt, error), params, columns []*Field) (*Stmt, error) {
+	return c.prepareStmt(query, params, columns, router.NewShardedStmt(rule, query, prepareBackend))
+}
+
+func (c *Conn) prepareStmt(query string, params, columns []*Field, sharded *router.ShardedStmt) (*Stmt, error) {
+	s := &Stmt{
+		ID:       c.nextStmtID(),
+		Query:    query,
+		Params:   params,
+		Columns:  columns,
+		Sharded:  sharded,
+		sentLong: make(map[uint16]bool),
+	}
+
+	if err := c.writePrepareOK(s); err != nil {
+		return nil, err
+	}
+
+	c.stmts[s.ID] = s
+
+	return s, nil
+}
+
+func (c *Conn) writePrepareOK(s *Stmt) error {
+	data := make([]byte, 4, 16)
+
+	data = append(data, mysql.OK_HEADER)
+	data = append(data, mysql.Uint32ToBytes(s.ID)...)
+	data = append(data, mysql.Uint16ToBytes(uint16(len(s.Columns)))...)
+	data = append(data, mysql.Uint16ToBytes(uint16(len(s.Params)))...)
+	data = append(data, 0)    // filler
+	data = append(data, 0, 0) // warning count
+
+	if err := c.WritePacket(data); err != nil {
+		return err
+	}
+
+	for _, p := range s.Params {
+		if err := c.WritePacket(append(make([]byte, 4), p.dump()...)); err != nil {
+			return err
+		}
+	}
+	if len(s.Params) > 0 {
+		if err := c.writeEOF(); err != nil {
+			return err
+		}
+	}
+
+	for _, col := range s.Columns {
+		if err := c.WritePacket(append(make([]byte, 4), col.dump()...)); err != nil {
+			return err
+		}
+	}
+	if len(s.Columns) > 0 {
+		if err := c.writeEOF(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Conn) writeEOF() error {
+	data := make([]byte, 4, 9)
+	data = append(data, mysql.EOF_HEADER)
+	data = append(data, 0, 0) // warning count
+	data = append(data, 0, 0) // status flags
+	return c.WritePacket(data)
+}
+
+// execute decodes a COM_STMT_EXECUTE command (with the command byte
+// already stripped) and fills in s.Args, mirroring Stmt.write in the
+// mysql package in reverse. Temporal params (MYSQL_TYPE_DATETIME,
+// MYSQL_TYPE_TIME and the like), which Stmt.write can also send, are not
+// decoded: execute returns an error for them.
+func (c *Conn) execute(data []byte) (*Stmt, error) {
+	if len(data) < 9 {
+		return nil, mysql.ErrMalformPacket
+	}
+
+	id := binary.LittleEndian.Uint32(data[0:4])
+	s, ok := c.stmts[id]
+	if !ok {
+		return nil, fmt.Errorf("stmt %d not found", id)
+	}
+
+	// data[4] is the cursor flag, data[5:9] the iteration count; the proxy
+	// always sees CURSOR_TYPE_NO_CURSOR and a single iteration.
+	pos := 9
+
+	paramCount := len(s.Params)
+	s.Args = make([]interface{}, paramCount)
+
+	if paramCount == 0 {
+		return s, nil
+	}
+
+	nullBitmapLen := (paramCount + 7) >> 3
+	if len(data) < pos+nullBitmapLen+1 {
+		return nil, mysql.ErrMalformPacket
+	}
+	nullBitmap := data[pos : pos+nullBitmapLen]
+	pos += nullBitmapLen
+
+	newParamsBound := data[pos]
+	pos++
+
+	if newParamsBound == 1 {
+		if len(data) < pos+(paramCount<<1) {
+			return nil, mysql.ErrMalformPacket
+		}
+		s.paramTypes = data[pos : pos+(paramCount<<1)]
+		pos += paramCount << 1
+	}
+	paramTypes := s.paramTypes
+	if len(paramTypes) < paramCount<<1 {
+		return nil, mysql.ErrMalformPacket
+	}
+
+	for i := 0; i < paramCount; i++ {
+		if nullBitmap[i/8]&(1<<(uint(i)%8)) > 0 {
+			s.Args[i] = nil
+			continue
+		}
+
+		if s.sentLong[uint16(i)] {
+			// Value was streamed earlier via COM_STMT_SEND_LONG_DATA and
+			// carries no inline value here.
+			s.Args[i] = s.longData[uint16(i)]
+			continue
+		}
+
+		tp := paramTypes[i<<1]
+		unsigned := paramTypes[(i<<1)+1]&0x80 > 0
+
+		v, n, err := decodeParam(tp, unsigned, data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		s.Args[i] = v
+		pos += n
+	}
+
+	return s, nil
+}
+
+func decodeParam(tp byte, unsigned bool, data []byte) (interface{}, int, error) {
+	switch tp {
+	case mysql.MYSQL_TYPE_NULL:
+		return nil, 0, nil
+	case mysql.MYSQL_TYPE_TINY:
+		if len(data) < 1 {
+			return nil, 0, mysql.ErrMalformPacket
+		}
+		if unsigned {
+			return uint8(data[0]), 1, nil
+		}
+		return int8(data[0]), 1, nil
+	case mysql.MYSQL_TYPE_SHORT, mysql.MYSQL_TYPE_YEAR:
+		if len(data) < 2 {
+			return nil, 0, mysql.ErrMalformPacket
+		}
+		v := binary.LittleEndian.Uint16(data)
+		if unsigned {
+			return v, 2, nil
+		}
+		return int16(v), 2, nil
+	case mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_INT24:
+		if len(data) < 4 {
+			return nil, 0, mysql.ErrMalformPacket
+		}
+		v := binary.LittleEndian.Uint32(data)
+		if unsigned {
+			return v, 4, nil
+		}
+		return int32(v), 4, nil
+	case mysql.MYSQL_TYPE_LONGLONG:
+		if len(data) < 8 {
+			return nil, 0, mysql.ErrMalformPacket
+		}
+		v := binary.LittleEndian.Uint64(data)
+		if unsigned {
+			return v, 8, nil
+		}
+		return int64(v), 8, nil
+	case mysql.MYSQL_TYPE_FLOAT:
+		if len(data) < 4 {
+			return nil, 0, mysql.ErrMalformPacket
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(data)), 4, nil
+	case mysql.MYSQL_TYPE_DOUBLE:
+		if len(data) < 8 {
+			return nil, 0, mysql.ErrMalformPacket
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), 8, nil
+	case mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_VAR_STRING, mysql.MYSQL_TYPE_VARCHAR,
+		mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_DECIMAL, mysql.MYSQL_TYPE_NEWDECIMAL:
+		v, isNull, n, err := decodeLengthEncodedString(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if isNull {
+			return nil, n, nil
+		}
+		return v, n, nil
+	default:
+		return nil, 0, fmt.Errorf("stmt execute: unsupported param type %d", tp)
+	}
+}
+
+func decodeLengthEncodedString(data []byte) (v string, isNull bool, n int, err error) {
+	if len(data) == 0 {
+		return "", false, 0, io.ErrUnexpectedEOF
+	}
+
+	switch data[0] {
+	case 0xfb:
+		return "", true, 1, nil
+	case 0xfc:
+		if len(data) < 3 {
+			return "", false, 0, mysql.ErrMalformPacket
+		}
+		length := int(binary.LittleEndian.Uint16(data[1:3]))
+		if len(data) < 3+length {
+			return "", false, 0, mysql.ErrMalformPacket
+		}
+		return string(data[3 : 3+length]), false, 3 + length, nil
+	case 0xfd:
+		if len(data) < 4 {
+			return "", false, 0, mysql.ErrMalformPacket
+		}
+		length := int(data[1]) | int(data[2])<<8 | int(data[3])<<16
+		if len(data) < 4+length {
+			return "", false, 0, mysql.ErrMalformPacket
+		}
+		return string(data[4 : 4+length]), false, 4 + length, nil
+	case 0xfe:
+		if len(data) < 9 {
+			return "", false, 0, mysql.ErrMalformPacket
+		}
+		length := int(binary.LittleEndian.Uint64(data[1:9]))
+		if len(data) < 9+length {
+			return "", false, 0, mysql.ErrMalformPacket
+		}
+		return string(data[9 : 9+length]), false, 9 + length, nil
+	default:
+		length := int(data[0])
+		if len(data) < 1+length {
+			return "", false, 0, mysql.ErrMalformPacket
+		}
+		return string(data[1 : 1+length]), false, 1 + length, nil
+	}
+}
+
+// sendLongData handles a COM_STMT_SEND_LONG_DATA command (command byte
+// already stripped): stmt id(4), param id(2), then the raw chunk, with
+// no response per the protocol.
+func (c *Conn) sendLongData(data []byte) error {
+	if len(data) < 6 {
+		return mysql.ErrMalformPacket
+	}
+
+	id := binary.LittleEndian.Uint32(data[0:4])
+	s, ok := c.stmts[id]
+	if !ok {
+		return fmt.Errorf("stmt %d not found", id)
+	}
+
+	paramIndex := binary.LittleEndian.Uint16(data[4:6])
+	s.appendLongData(paramIndex, data[6:])
+
+	return nil
+}
+
+// reset handles a COM_STMT_RESET command, clearing any
+// COM_STMT_SEND_LONG_DATA state for the statement and answering OK.
+func (c *Conn) reset(data []byte) error {
+	if len(data) < 4 {
+		return mysql.ErrMalformPacket
+	}
+
+	id := binary.LittleEndian.Uint32(data)
+	s, ok := c.stmts[id]
+	if !ok {
+		return fmt.Errorf("stmt %d not found", id)
+	}
+
+	s.resetLongData()
+
+	return c.writeOK()
+}
+
+// executeSharded is a no-op for a plain (non-sharded) statement, since
+// some other handler still owns deciding what to do with s.Args in that
+// case. For a statement prepared with PrepareSharded, it runs s.Args
+// against the backend(s) s.Sharded resolves to and writes the result
+// straight back to the client: a resultset if the prepare declared
+// result columns (a SELECT), otherwise an OK packet.
+func (c *Conn) executeSharded(s *Stmt) error {
+	if s.Sharded == nil {
+		return nil
+	}
+
+	if len(s.Columns) > 0 {
+		r, err := s.Sharded.Query(s.Args...)
+		if err != nil {
+			return err
+		}
+		return c.writeResultset(s.Columns, r.RowDatas)
+	}
+
+	ok, err := s.Sharded.Exec(s.Args...)
+	if err != nil {
+		return err
+	}
+	return c.writeOKResult(ok)
+}
+
+// writeResultset answers with columns' definitions followed by rowDatas
+// unchanged: each row was already decoded and re-encoded once by the
+// backend that produced it, so forwarding the raw packets avoids paying
+// for that work a second time.
+func (c *Conn) writeResultset(columns []*Field, rowDatas [][]byte) error {
+	data := make([]byte, 4, 9)
+	data = append(data, mysql.PutLengthEncodedInt(uint64(len(columns)))...)
+	if err := c.WritePacket(data); err != nil {
+		return err
+	}
+
+	for _, col := range columns {
+		if err := c.WritePacket(append(make([]byte, 4), col.dump()...)); err != nil {
+			return err
+		}
+	}
+	if err := c.writeEOF(); err != nil {
+		return err
+	}
+
+	for _, row := range rowDatas {
+		if err := c.WritePacket(append(make([]byte, 4), row...)); err != nil {
+			return err
+		}
+	}
+
+	return c.writeEOF()
+}
+
+// writeOKResult answers with ok's affected-rows/insert-id, the sharded
+// counterpart of writeOK's bare zero-value ack.
+func (c *Conn) writeOKResult(ok *mysql.OKPacket) error {
+	data := make([]byte, 4, 11)
+
+	data = append(data, mysql.OK_HEADER)
+	data = append(data, mysql.PutLengthEncodedInt(ok.AffectedRows)...)
+	data = append(data, mysql.PutLengthEncodedInt(ok.InsertId)...)
+	data = append(data, 0, 0) // status flags
+	data = append(data, 0, 0) // warnings
+
+	return c.WritePacket(data)
+}
+
+// close handles a COM_STMT_CLOSE; per the protocol it has no response.
+func (c *Conn) close(data []byte) error {
+	if len(data) < 4 {
+		return mysql.ErrMalformPacket
+	}
+	delete(c.stmts, binary.LittleEndian.Uint32(data))
+	return nil
+}
+
+// dispatchStmt routes a COM_STMT_* command (command byte still present)
+// to the handlers above. Other commands are the concern of the
+// surrounding proxy front-end.
+func (c *Conn) dispatchStmt(data []byte) error {
+	switch data[0] {
+	case mysql.COM_STMT_EXECUTE:
+		s, err := c.execute(data[1:])
+		if err != nil {
+			return err
+		}
+		return c.executeSharded(s)
+	case mysql.COM_STMT_SEND_LONG_DATA:
+		return c.sendLongData(data[1:])
+	case mysql.COM_STMT_RESET:
+		return c.reset(data[1:])
+	case mysql.COM_STMT_CLOSE:
+		return c.close(data[1:])
+	default:
+		return fmt.Errorf("stmt: unexpected command %d", data[0])
+	}
+}